@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/tox-in/Certify/certifyerr"
+)
+
+// AdminType mirrors smallstep's admin.Type split between an admin that can
+// act across every scope and one that is restricted to a single scope.
+type AdminType string
+
+const (
+	// AdminTypeSuper can act on any scope, regardless of what Scope is set
+	// on its Admin record.
+	AdminTypeSuper AdminType = "SUPER_ADMIN"
+	// AdminTypeRegular is restricted to the scope recorded on its Admin
+	// record.
+	AdminTypeRegular AdminType = "REGULAR"
+)
+
+// Scopes mirror the roles the old cert-attribute gate used to check.
+const (
+	ScopeRegistrar = "registrar"
+	ScopeCertifier = "certifier"
+	ScopeAdmin     = "admin"
+)
+
+const adminKeyPrefix = "ADMIN_"
+
+// Admin is a delegated operator recorded on-chain, replacing the bare "role"
+// cert attribute as the source of truth for who can call privileged
+// SmartContract methods.
+type Admin struct {
+	DocType string `json:"docType"`
+	ID      string `json:"id"`
+	// Subject is the exact string cid.GetID returns for this admin's
+	// client identity (an MSPID-scoped, base64-encoded composite of its
+	// X.509 subject and issuer DNs), not a bare X.509 subject DN. A
+	// prospective admin must call GetCallerIdentity themselves and hand
+	// that value to whoever registers them with AddAdmin, since it can't
+	// be derived from MSPID and a subject DN alone.
+	Subject   string    `json:"subject"`
+	MSPID     string    `json:"mspId"`
+	Type      AdminType `json:"type"`
+	Scope     string    `json:"scope"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func adminKey(id string) string {
+	return adminKeyPrefix + id
+}
+
+// AddAdmin registers a new delegated admin. subject must be the exact
+// value GetCallerIdentity returned for the client being granted access,
+// not an X.509 subject DN — have that client call GetCallerIdentity
+// themselves and pass you the result out of band. SUPER_ADMIN can add
+// admins of any type; a REGULAR admin cannot grant privileges it does not
+// itself have. The very first admin must be added by a client still
+// carrying the legacy "admin" cert attribute, since the registry has no
+// other way to bootstrap itself.
+func (s *SmartContract) AddAdmin(ctx contractapi.TransactionContextInterface, id string, subject string, mspID string, adminType AdminType, scope string) error {
+	if adminType != AdminTypeSuper && adminType != AdminTypeRegular {
+		return certifyerr.Errorf(certifyerr.TypeInvalidArgument, "invalid admin type %q", adminType)
+	}
+	if adminType == AdminTypeRegular && scope == "" {
+		return certifyerr.Errorf(certifyerr.TypeInvalidArgument, "a REGULAR admin requires a scope")
+	}
+
+	caller, err := requireAdmin(ctx, ScopeAdmin)
+	if err != nil {
+		return err
+	}
+	if err := requireAdminGrant(caller, adminType, scope); err != nil {
+		return err
+	}
+
+	exists, err := s.adminExists(ctx, id)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return certifyerr.Errorf(certifyerr.TypeAlreadyExists, "the admin %s already exists", id)
+	}
+
+	admin := Admin{
+		DocType:   "admin",
+		ID:        id,
+		Subject:   subject,
+		MSPID:     mspID,
+		Type:      adminType,
+		Scope:     scope,
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+	}
+
+	adminJSON, err := json.Marshal(admin)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(adminKey(id), adminJSON)
+}
+
+// UpdateAdmin changes the type and/or scope of an existing admin.
+func (s *SmartContract) UpdateAdmin(ctx contractapi.TransactionContextInterface, id string, adminType AdminType, scope string) error {
+	if adminType != AdminTypeSuper && adminType != AdminTypeRegular {
+		return certifyerr.Errorf(certifyerr.TypeInvalidArgument, "invalid admin type %q", adminType)
+	}
+	if adminType == AdminTypeRegular && scope == "" {
+		return certifyerr.Errorf(certifyerr.TypeInvalidArgument, "a REGULAR admin requires a scope")
+	}
+
+	caller, err := requireAdmin(ctx, ScopeAdmin)
+	if err != nil {
+		return err
+	}
+	if err := requireAdminGrant(caller, adminType, scope); err != nil {
+		return err
+	}
+
+	admin, err := s.getAdmin(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	admin.Type = adminType
+	admin.Scope = scope
+	admin.UpdatedAt = time.Now().UTC()
+
+	adminJSON, err := json.Marshal(admin)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(adminKey(id), adminJSON)
+}
+
+// RemoveAdmin revokes an admin's delegated permissions.
+func (s *SmartContract) RemoveAdmin(ctx contractapi.TransactionContextInterface, id string) error {
+	if _, err := requireAdmin(ctx, ScopeAdmin); err != nil {
+		return err
+	}
+
+	if _, err := s.getAdmin(ctx, id); err != nil {
+		return err
+	}
+
+	return ctx.GetStub().DelState(adminKey(id))
+}
+
+// AdminPage is a single page of admins, plus the opaque cursor to pass back
+// in to fetch the next page.
+type AdminPage struct {
+	Admins     []*Admin `json:"admins"`
+	NextCursor string   `json:"nextCursor"`
+}
+
+// ListAdmins returns a page of admins ordered by key, starting after
+// cursor. An empty cursor starts from the beginning. limit caps the page
+// size; callers should pass the returned NextCursor back in to continue.
+func (s *SmartContract) ListAdmins(ctx contractapi.TransactionContextInterface, cursor string, limit int32) (*AdminPage, error) {
+	if _, err := requireAdmin(ctx, ScopeAdmin); err != nil {
+		return nil, err
+	}
+
+	cursor, limit, err := ParseCursor(cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByRangeWithPagination(adminKeyPrefix, adminKeyPrefix+string('￿'), limit, cursor)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var admins []*Admin
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var admin Admin
+		if err := json.Unmarshal(queryResult.Value, &admin); err != nil {
+			return nil, err
+		}
+		admins = append(admins, &admin)
+	}
+
+	return &AdminPage{Admins: admins, NextCursor: responseMetadata.Bookmark}, nil
+}
+
+func (s *SmartContract) adminExists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
+	adminJSON, err := ctx.GetStub().GetState(adminKey(id))
+	if err != nil {
+		return false, certifyerr.Errorf(certifyerr.TypeInternal, "failed to read from world state: %v", err)
+	}
+	return adminJSON != nil, nil
+}
+
+func (s *SmartContract) getAdmin(ctx contractapi.TransactionContextInterface, id string) (*Admin, error) {
+	adminJSON, err := ctx.GetStub().GetState(adminKey(id))
+	if err != nil {
+		return nil, certifyerr.Errorf(certifyerr.TypeInternal, "failed to read from world state: %v", err)
+	}
+	if adminJSON == nil {
+		return nil, certifyerr.Errorf(certifyerr.TypeAdminNotFound, "the admin %s does not exist", id)
+	}
+
+	var admin Admin
+	if err := json.Unmarshal(adminJSON, &admin); err != nil {
+		return nil, err
+	}
+
+	return &admin, nil
+}
+
+// requireAdminGrant enforces that a caller cannot use AddAdmin/UpdateAdmin to
+// grant privileges it does not itself have: a SUPER_ADMIN (or the bootstrap
+// caller, represented by a nil caller) may mint an admin of any type or
+// scope, but a REGULAR admin may only create/update other REGULAR admins
+// scoped to the same scope it already holds.
+func requireAdminGrant(caller *Admin, adminType AdminType, scope string) error {
+	if caller == nil || caller.Type == AdminTypeSuper {
+		return nil
+	}
+
+	if adminType != AdminTypeRegular || scope != caller.Scope {
+		return certifyerr.Errorf(certifyerr.TypeUnauthorizedRole, "a REGULAR admin cannot grant privileges it does not itself have")
+	}
+
+	return nil
+}
+
+// GetCallerIdentity returns cid.GetID for the calling client, i.e. the
+// exact string that must be stored as an Admin's Subject for requireAdmin
+// to recognize that client. It takes no scope and performs no
+// authorization check, so a prospective admin can call it to discover
+// the value to hand to whoever will register them with AddAdmin.
+func (s *SmartContract) GetCallerIdentity(ctx contractapi.TransactionContextInterface) (string, error) {
+	clientID, err := cid.GetID(ctx.GetStub())
+	if err != nil {
+		return "", certifyerr.Errorf(certifyerr.TypeInternal, "failed to get client identity: %v", err)
+	}
+	return clientID, nil
+}
+
+// lookupAdminBySubject finds the Admin record for a given client subject
+// (as returned by GetCallerIdentity), if one has been registered.
+func lookupAdminBySubject(ctx contractapi.TransactionContextInterface, subject string) (*Admin, error) {
+	queryString := fmt.Sprintf(`{"selector":{"docType":"admin","subject":%s}}`, jsonString(subject))
+
+	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	if !resultsIterator.HasNext() {
+		return nil, nil
+	}
+
+	queryResult, err := resultsIterator.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	var admin Admin
+	if err := json.Unmarshal(queryResult.Value, &admin); err != nil {
+		return nil, err
+	}
+
+	return &admin, nil
+}
+
+// anyAdminExists reports whether the AdminRegistry has been bootstrapped
+// yet, so requireAdmin knows whether to still honor the legacy "role" cert
+// attribute.
+func anyAdminExists(ctx contractapi.TransactionContextInterface) (bool, error) {
+	resultsIterator, err := ctx.GetStub().GetQueryResult(`{"selector":{"docType":"admin"}}`)
+	if err != nil {
+		return false, err
+	}
+	defer resultsIterator.Close()
+
+	return resultsIterator.HasNext(), nil
+}
+
+// requireAdmin checks that the calling client is a SUPER_ADMIN, or a
+// REGULAR admin scoped to the requested scope. SUPER_ADMIN overrides any
+// REGULAR scoping. Until the first admin has been registered, it falls back
+// to the legacy "role" cert attribute so the registry can be bootstrapped.
+func requireAdmin(ctx contractapi.TransactionContextInterface, scope string) (*Admin, error) {
+	clientID, err := cid.GetID(ctx.GetStub())
+	if err != nil {
+		return nil, certifyerr.Errorf(certifyerr.TypeInternal, "failed to get client identity: %v", err)
+	}
+
+	admin, err := lookupAdminBySubject(ctx, clientID)
+	if err != nil {
+		return nil, certifyerr.Errorf(certifyerr.TypeInternal, "failed to look up admin registry: %v", err)
+	}
+
+	if admin != nil {
+		if admin.Type == AdminTypeSuper || (admin.Type == AdminTypeRegular && admin.Scope == scope) {
+			return admin, nil
+		}
+		return nil, certifyerr.Errorf(certifyerr.TypeUnauthorizedRole, "client %s does not have required scope: %s", clientID, scope)
+	}
+
+	bootstrapped, err := anyAdminExists(ctx)
+	if err != nil {
+		return nil, certifyerr.Errorf(certifyerr.TypeInternal, "failed to check admin registry: %v", err)
+	}
+	if !bootstrapped {
+		if err := checkRole(ctx, scope); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	return nil, certifyerr.Errorf(certifyerr.TypeUnauthorizedRole, "client %s is not a registered admin", clientID)
+}
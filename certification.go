@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/tox-in/Certify/certifyerr"
+)
+
+// defaultCertificateValidityDays is how long a freshly issued certificate
+// is valid for when CertifyEnterprise does not otherwise know a validity
+// period.
+const defaultCertificateValidityDays = 365
+
+// defaultRenewalWindowDays is how far before CertificateExpiry a renewal is
+// accepted when no on-chain override has been set via
+// SetRenewalWindowDays. Requests made earlier than this are rejected so
+// renewals don't reset the expiry clock indefinitely.
+const defaultRenewalWindowDays = 30
+
+const renewalWindowConfigKey = "CONFIG_renewalWindowDays"
+
+// renewalWindowConfig is the persisted, admin-settable override for the
+// renewal window, so the window is configurable on-chain rather than a
+// compile-time constant.
+type renewalWindowConfig struct {
+	DocType string `json:"docType"`
+	Days    int    `json:"days"`
+}
+
+// SetRenewalWindowDays lets a ScopeAdmin operator change how far before
+// CertificateExpiry a renewal is accepted.
+func (s *SmartContract) SetRenewalWindowDays(ctx contractapi.TransactionContextInterface, days int) error {
+	if _, err := requireAdmin(ctx, ScopeAdmin); err != nil {
+		return err
+	}
+
+	if days <= 0 {
+		return certifyerr.Errorf(certifyerr.TypeInvalidArgument, "days must be positive")
+	}
+
+	config := renewalWindowConfig{DocType: "config", Days: days}
+
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(renewalWindowConfigKey, configJSON)
+}
+
+// getRenewalWindowDays returns the on-chain renewal window, falling back to
+// defaultRenewalWindowDays when no override has been set.
+func getRenewalWindowDays(ctx contractapi.TransactionContextInterface) (int, error) {
+	configJSON, err := ctx.GetStub().GetState(renewalWindowConfigKey)
+	if err != nil {
+		return 0, certifyerr.Errorf(certifyerr.TypeInternal, "failed to read from world state: %v", err)
+	}
+	if configJSON == nil {
+		return defaultRenewalWindowDays, nil
+	}
+
+	var config renewalWindowConfig
+	if err := json.Unmarshal(configJSON, &config); err != nil {
+		return 0, err
+	}
+
+	return config.Days, nil
+}
+
+// CertificateRecord is a point-in-time snapshot of a certificate that has
+// since been replaced by a renewal or a rekey.
+type CertificateRecord struct {
+	CertificateID string    `json:"certificateId"`
+	IssuedAt      time.Time `json:"issuedAt"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+	Rekeyed       bool      `json:"rekeyed"`
+}
+
+// RenewCertification issues a new certificate for an enterprise whose
+// current certificate is approaching expiry, valid for validityDays from
+// the time of renewal, without touching its public key. The enterprise must
+// already be CERTIFIED and within the configured renewal window (see
+// SetRenewalWindowDays) of CertificateExpiry.
+func (s *SmartContract) RenewCertification(ctx contractapi.TransactionContextInterface, id string, validityDays int) error {
+	if _, err := requireAdmin(ctx, ScopeCertifier); err != nil {
+		return err
+	}
+
+	if validityDays <= 0 {
+		return certifyerr.Errorf(certifyerr.TypeInvalidArgument, "validityDays must be positive")
+	}
+
+	enterprise, err := s.QueryEnterprise(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if enterprise.State != "CERTIFIED" {
+		return certifyerr.Errorf(certifyerr.TypeInvalidStateTransition, "enterprise %s is not CERTIFIED", id)
+	}
+
+	renewalWindowDays, err := getRenewalWindowDays(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	renewalWindowStart := enterprise.CertificateExpiry.AddDate(0, 0, -renewalWindowDays)
+	if now.Before(renewalWindowStart) {
+		return certifyerr.Errorf(certifyerr.TypeInvalidStateTransition, "enterprise %s is not yet within the %d day renewal window", id, renewalWindowDays)
+	}
+
+	enterprise.CertificateHistory = append(enterprise.CertificateHistory, CertificateRecord{
+		CertificateID: enterprise.CertificateID,
+		IssuedAt:      enterprise.CertificationDate,
+		ExpiresAt:     enterprise.CertificateExpiry,
+		Rekeyed:       false,
+	})
+
+	enterprise.CertificateID = generateCertificateID()
+	enterprise.CertificationDate = now
+	enterprise.CertificateExpiry = now.AddDate(0, 0, validityDays)
+	enterprise.UpdatedAt = now
+
+	enterpriseJSON, err := json.Marshal(enterprise)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(enterpriseKey(id), enterpriseJSON)
+}
+
+// RekeyCertification issues a new certificate bound to newPublicKeyPEM,
+// invalidating the enterprise's previous public key without changing its
+// CertificateExpiry. Use this when an enterprise's private key may have
+// been compromised but its certification is still otherwise valid.
+func (s *SmartContract) RekeyCertification(ctx contractapi.TransactionContextInterface, id string, newPublicKeyPEM string) error {
+	if _, err := requireAdmin(ctx, ScopeCertifier); err != nil {
+		return err
+	}
+
+	if newPublicKeyPEM == "" {
+		return certifyerr.Errorf(certifyerr.TypeInvalidArgument, "newPublicKeyPEM must not be empty")
+	}
+
+	enterprise, err := s.QueryEnterprise(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if enterprise.State != "CERTIFIED" {
+		return certifyerr.Errorf(certifyerr.TypeInvalidStateTransition, "enterprise %s is not CERTIFIED", id)
+	}
+
+	if newPublicKeyPEM == enterprise.PublicKey {
+		return certifyerr.Errorf(certifyerr.TypeInvalidArgument, "newPublicKeyPEM must differ from the current public key")
+	}
+
+	now := time.Now().UTC()
+
+	enterprise.CertificateHistory = append(enterprise.CertificateHistory, CertificateRecord{
+		CertificateID: enterprise.CertificateID,
+		IssuedAt:      enterprise.CertificationDate,
+		ExpiresAt:     enterprise.CertificateExpiry,
+		Rekeyed:       true,
+	})
+
+	enterprise.CertificateID = generateCertificateID()
+	enterprise.CertificationDate = now
+	enterprise.PublicKey = newPublicKeyPEM
+	enterprise.UpdatedAt = now
+
+	enterpriseJSON, err := json.Marshal(enterprise)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(enterpriseKey(id), enterpriseJSON)
+}
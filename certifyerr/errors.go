@@ -0,0 +1,94 @@
+// Package certifyerr defines the typed error shape SmartContract methods
+// return for the failures they detect themselves, modeled on the
+// mgmt.Error/acme.Error pattern from smallstep's api.WriteError: a stable
+// Type string plus an HTTP-style Code, marshaled as JSON into the error
+// string so off-chain gateways and SDKs can switch on Type instead of
+// substring-matching English messages. Errors passed up unchanged from the
+// ledger stub or from JSON encoding are returned as they are, not as this
+// type.
+package certifyerr
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Code is an HTTP-style status code describing the general class of
+// failure, independent of the more specific Type.
+type Code int
+
+const (
+	CodeInvalid      Code = 400
+	CodeUnauthorized Code = 403
+	CodeNotFound     Code = 404
+	CodeConflict     Code = 409
+	CodeInternal     Code = 500
+)
+
+// Type identifies the specific failure a client can switch on.
+type Type string
+
+const (
+	TypeEnterpriseNotFound     Type = "ENTERPRISE_NOT_FOUND"
+	TypeAdminNotFound          Type = "ADMIN_NOT_FOUND"
+	TypeInvalidStateTransition Type = "INVALID_STATE_TRANSITION"
+	TypeUnauthorizedRole       Type = "UNAUTHORIZED_ROLE"
+	TypeAlreadyExists          Type = "ALREADY_EXISTS"
+	TypeInvalidArgument        Type = "INVALID_ARGUMENT"
+	TypeInternal               Type = "INTERNAL"
+)
+
+// codeForType supplies the default Code for a Type, so callers constructing
+// an Error via Errorf don't have to pick one explicitly.
+func codeForType(typ Type) Code {
+	switch typ {
+	case TypeEnterpriseNotFound, TypeAdminNotFound:
+		return CodeNotFound
+	case TypeAlreadyExists:
+		return CodeConflict
+	case TypeUnauthorizedRole:
+		return CodeUnauthorized
+	case TypeInvalidStateTransition, TypeInvalidArgument:
+		return CodeInvalid
+	default:
+		return CodeInternal
+	}
+}
+
+// Error is the typed error SmartContract methods return in place of a raw
+// fmt.Errorf string.
+type Error struct {
+	Code    Code   `json:"code"`
+	Type    Type   `json:"type"`
+	Message string `json:"message"`
+	Details string `json:"details,omitempty"`
+}
+
+// Error implements the error interface by marshaling the Error as JSON, so
+// the chaincode response payload a client receives is machine-readable
+// rather than free text.
+func (e *Error) Error() string {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return e.Message
+	}
+	return string(b)
+}
+
+// Errorf builds an Error of the given Type, formatting Message the same way
+// fmt.Errorf does.
+func Errorf(typ Type, format string, args ...interface{}) *Error {
+	return &Error{
+		Code:    codeForType(typ),
+		Type:    typ,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// WithDetails returns a copy of e with Details set, for attaching extra
+// machine-readable context (e.g. the offending field) beyond Message.
+func (e *Error) WithDetails(details string) *Error {
+	withDetails := *e
+	withDetails.Details = details
+	return &withDetails
+}
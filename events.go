@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/tox-in/Certify/certifyerr"
+)
+
+// Event names emitted via ctx.GetStub().SetEvent, one per lifecycle
+// transition, so off-chain listeners (indexers, notification services) can
+// react to state changes without polling the world state.
+const (
+	EventEnterpriseRegistered    = "EnterpriseRegistered"
+	EventEnterpriseCertified     = "EnterpriseCertified"
+	EventCertificationRevoked    = "CertificationRevoked"
+	EventEnterpriseBlacklisted   = "EnterpriseBlacklisted"
+	EventEnterpriseUnblacklisted = "EnterpriseUnblacklisted"
+	EventOrganizationsAssigned   = "OrganizationsAssigned"
+	EventChannelsAssigned        = "ChannelsAssigned"
+)
+
+// EnterpriseRegisteredEvent is the payload emitted when an enterprise is
+// first registered.
+type EnterpriseRegisteredEvent struct {
+	ID        string    `json:"id"`
+	Actor     string    `json:"actor"`
+	Timestamp time.Time `json:"timestamp"`
+	Name      string    `json:"name"`
+}
+
+// EnterpriseCertifiedEvent is the payload emitted when an enterprise is
+// certified.
+type EnterpriseCertifiedEvent struct {
+	ID            string    `json:"id"`
+	Actor         string    `json:"actor"`
+	Timestamp     time.Time `json:"timestamp"`
+	CertificateID string    `json:"certificateId"`
+}
+
+// CertificationRevokedEvent is the payload emitted when a certification is
+// revoked.
+type CertificationRevokedEvent struct {
+	ID                   string    `json:"id"`
+	Actor                string    `json:"actor"`
+	Timestamp            time.Time `json:"timestamp"`
+	RevokedCertificateID string    `json:"revokedCertificateId"`
+	Reason               string    `json:"reason"`
+}
+
+// EnterpriseBlacklistedEvent is the payload emitted when an enterprise is
+// blacklisted.
+type EnterpriseBlacklistedEvent struct {
+	ID        string    `json:"id"`
+	Actor     string    `json:"actor"`
+	Timestamp time.Time `json:"timestamp"`
+	Reason    string    `json:"reason"`
+}
+
+// EnterpriseUnblacklistedEvent is the payload emitted when an enterprise is
+// unblacklisted.
+type EnterpriseUnblacklistedEvent struct {
+	ID            string    `json:"id"`
+	Actor         string    `json:"actor"`
+	Timestamp     time.Time `json:"timestamp"`
+	RestoredState string    `json:"restoredState"`
+}
+
+// OrganizationsAssignedEvent is the payload emitted when an enterprise's
+// organizations are (re)assigned.
+type OrganizationsAssignedEvent struct {
+	ID            string    `json:"id"`
+	Actor         string    `json:"actor"`
+	Timestamp     time.Time `json:"timestamp"`
+	Organizations []string  `json:"organizations"`
+}
+
+// ChannelsAssignedEvent is the payload emitted when an enterprise's
+// channels are (re)assigned.
+type ChannelsAssignedEvent struct {
+	ID        string    `json:"id"`
+	Actor     string    `json:"actor"`
+	Timestamp time.Time `json:"timestamp"`
+	Channels  []string  `json:"channels"`
+}
+
+func emitEnterpriseRegistered(ctx contractapi.TransactionContextInterface, enterprise *Enterprise) error {
+	actor, err := eventActor(ctx)
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, EventEnterpriseRegistered, EnterpriseRegisteredEvent{
+		ID:        enterprise.ID,
+		Actor:     actor,
+		Timestamp: time.Now().UTC(),
+		Name:      enterprise.Name,
+	})
+}
+
+func emitEnterpriseCertified(ctx contractapi.TransactionContextInterface, enterprise *Enterprise) error {
+	actor, err := eventActor(ctx)
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, EventEnterpriseCertified, EnterpriseCertifiedEvent{
+		ID:            enterprise.ID,
+		Actor:         actor,
+		Timestamp:     time.Now().UTC(),
+		CertificateID: enterprise.CertificateID,
+	})
+}
+
+func emitCertificationRevoked(ctx contractapi.TransactionContextInterface, enterprise *Enterprise, revokedCertificateID string) error {
+	actor, err := eventActor(ctx)
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, EventCertificationRevoked, CertificationRevokedEvent{
+		ID:                   enterprise.ID,
+		Actor:                actor,
+		Timestamp:            time.Now().UTC(),
+		RevokedCertificateID: revokedCertificateID,
+		Reason:               enterprise.RevocationReason,
+	})
+}
+
+func emitEnterpriseBlacklisted(ctx contractapi.TransactionContextInterface, enterprise *Enterprise) error {
+	actor, err := eventActor(ctx)
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, EventEnterpriseBlacklisted, EnterpriseBlacklistedEvent{
+		ID:        enterprise.ID,
+		Actor:     actor,
+		Timestamp: time.Now().UTC(),
+		Reason:    enterprise.BlacklistReason,
+	})
+}
+
+func emitEnterpriseUnblacklisted(ctx contractapi.TransactionContextInterface, enterprise *Enterprise) error {
+	actor, err := eventActor(ctx)
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, EventEnterpriseUnblacklisted, EnterpriseUnblacklistedEvent{
+		ID:            enterprise.ID,
+		Actor:         actor,
+		Timestamp:     time.Now().UTC(),
+		RestoredState: enterprise.State,
+	})
+}
+
+func emitOrganizationsAssigned(ctx contractapi.TransactionContextInterface, enterprise *Enterprise) error {
+	actor, err := eventActor(ctx)
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, EventOrganizationsAssigned, OrganizationsAssignedEvent{
+		ID:            enterprise.ID,
+		Actor:         actor,
+		Timestamp:     time.Now().UTC(),
+		Organizations: enterprise.Organizations,
+	})
+}
+
+func emitChannelsAssigned(ctx contractapi.TransactionContextInterface, enterprise *Enterprise) error {
+	actor, err := eventActor(ctx)
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, EventChannelsAssigned, ChannelsAssignedEvent{
+		ID:        enterprise.ID,
+		Actor:     actor,
+		Timestamp: time.Now().UTC(),
+		Channels:  enterprise.Channels,
+	})
+}
+
+func eventActor(ctx contractapi.TransactionContextInterface) (string, error) {
+	actor, err := cid.GetID(ctx.GetStub())
+	if err != nil {
+		return "", certifyerr.Errorf(certifyerr.TypeInternal, "failed to get client identity: %v", err)
+	}
+	return actor, nil
+}
+
+func emitEvent(ctx contractapi.TransactionContextInterface, name string, payload interface{}) error {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return certifyerr.Errorf(certifyerr.TypeInternal, "failed to marshal %s event payload: %v", name, err)
+	}
+	return ctx.GetStub().SetEvent(name, payloadJSON)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/tox-in/Certify/certifyerr"
+)
+
+// StateTransition is a single recorded move between Enterprise.State values.
+// It replaces the old PREVIOUS_STATE-in-Details hack: every state-changing
+// method appends one of these instead of mangling Details, so the full
+// lifecycle survives rather than just the single most recent state.
+type StateTransition struct {
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Actor  string    `json:"actor"`
+	Reason string    `json:"reason"`
+	At     time.Time `json:"at"`
+	TxID   string    `json:"txId"`
+}
+
+// appendTransition records a state transition onto enterprise.History,
+// attributing it to the calling client identity and the current
+// transaction ID.
+func appendTransition(ctx contractapi.TransactionContextInterface, enterprise *Enterprise, from string, to string, reason string) error {
+	actor, err := cid.GetID(ctx.GetStub())
+	if err != nil {
+		return certifyerr.Errorf(certifyerr.TypeInternal, "failed to get client identity: %v", err)
+	}
+
+	enterprise.History = append(enterprise.History, StateTransition{
+		From:   from,
+		To:     to,
+		Actor:  actor,
+		Reason: reason,
+		At:     time.Now().UTC(),
+		TxID:   ctx.GetStub().GetTxID(),
+	})
+
+	return nil
+}
+
+// lastNonBlacklistedState walks history backwards and returns the state the
+// enterprise was in immediately before it was last blacklisted.
+func lastNonBlacklistedState(history []StateTransition) (string, error) {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].To != "BLACKLISTED" {
+			return history[i].To, nil
+		}
+	}
+	return "", certifyerr.Errorf(certifyerr.TypeInternal, "no pre-blacklist state found in history")
+}
+
+// QueryEnterpriseHistory returns the enterprise's recorded state-transition
+// log, cross-checked against the ledger's own block-level history for the
+// key: GetHistoryForKey gives every past version of the document, newest
+// first, and each version's History must be a prefix of (or equal to) the
+// next version's. If some later version has fewer transitions than an earlier
+// one, or rewrites an entry an earlier version already recorded, the
+// stored History has been tampered with or corrupted, and the query fails
+// rather than returning it.
+func (s *SmartContract) QueryEnterpriseHistory(ctx contractapi.TransactionContextInterface, id string) ([]StateTransition, error) {
+	enterprise, err := s.QueryEnterprise(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ledgerIterator, err := ctx.GetStub().GetHistoryForKey(enterpriseKey(id))
+	if err != nil {
+		return nil, err
+	}
+	defer ledgerIterator.Close()
+
+	var versions []Enterprise
+	for ledgerIterator.HasNext() {
+		modification, err := ledgerIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if modification.IsDelete {
+			continue
+		}
+
+		var version Enterprise
+		if err := json.Unmarshal(modification.Value, &version); err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+
+	// versions is newest-first; walk it oldest-to-newest so older/newer
+	// below line up with how History is meant to grow over time.
+	for i := len(versions) - 1; i > 0; i-- {
+		older, newer := versions[i], versions[i-1]
+
+		if len(newer.History) < len(older.History) {
+			return nil, certifyerr.Errorf(certifyerr.TypeInternal, "enterprise %s history is inconsistent: a later version has fewer transitions (%d) than an earlier one (%d)", id, len(newer.History), len(older.History))
+		}
+
+		for j := range older.History {
+			if newer.History[j] != older.History[j] {
+				return nil, certifyerr.Errorf(certifyerr.TypeInternal, "enterprise %s history is inconsistent: transition %d was rewritten", id, j)
+			}
+		}
+	}
+
+	return enterprise.History, nil
+}
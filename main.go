@@ -3,34 +3,47 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/tox-in/Certify/certifyerr"
 )
 
 type SmartContract struct {
 	contractapi.Contract
 }
 
+// enterpriseKeyPrefix namespaces Enterprise world-state keys apart from
+// Admin world-state keys (see adminKeyPrefix), so an enterprise id can
+// never collide with an admin id sharing the same underlying key.
+const enterpriseKeyPrefix = "ENTERPRISE_"
+
+func enterpriseKey(id string) string {
+	return enterpriseKeyPrefix + id
+}
+
 type Enterprise struct {
-	DocType           string    `json:"docType"`
-	ID                string    `json:"id"`
-	Name              string    `json:"name"`
-	Details           string    `json:"details"`
-	State             string    `json:"state"`
-	CertificateID     string    `json:"certificateId"`
-	CertificationDate time.Time `json:"certificationDate"`
-	CertifiedBy       string    `json:"certifiedBy"`
-	RevocationDate    time.Time `json:"revocationDate"`
-	RevocationReason  string    `json:"revocationReason"`
-	BlacklistDate     time.Time `json:"blacklistDate"`
-	BlacklistReason   string    `json:"blacklistReason"`
-	Organizations     []string  `json:"organizations"`
-	Channels          []string  `json:"channels"`
-	CreatedAt         time.Time `json:"createdAt"`
-	UpdatedAt         time.Time `json:"updatedAt"`
+	DocType            string              `json:"docType"`
+	ID                 string              `json:"id"`
+	Name               string              `json:"name"`
+	Details            string              `json:"details"`
+	State              string              `json:"state"`
+	CertificateID      string              `json:"certificateId"`
+	CertificationDate  time.Time           `json:"certificationDate"`
+	CertificateExpiry  time.Time           `json:"certificateExpiry"`
+	PublicKey          string              `json:"publicKey"`
+	CertificateHistory []CertificateRecord `json:"certificateHistory"`
+	CertifiedBy        string              `json:"certifiedBy"`
+	RevocationDate     time.Time           `json:"revocationDate"`
+	RevocationReason   string              `json:"revocationReason"`
+	BlacklistDate      time.Time           `json:"blacklistDate"`
+	BlacklistReason    string              `json:"blacklistReason"`
+	Organizations      []string            `json:"organizations"`
+	Channels           []string            `json:"channels"`
+	CreatedAt          time.Time           `json:"createdAt"`
+	UpdatedAt          time.Time           `json:"updatedAt"`
+	History            []StateTransition   `json:"history"`
 }
 
 func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface) error {
@@ -39,8 +52,7 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 }
 
 func (s *SmartContract) RegisterEnterprise(ctx contractapi.TransactionContextInterface, id string, name string, details string) error {
-	err := checkRole(ctx, "registrar")
-	if err != nil {
+	if _, err := requireAdmin(ctx, ScopeRegistrar); err != nil {
 		return err
 	}
 
@@ -49,7 +61,7 @@ func (s *SmartContract) RegisterEnterprise(ctx contractapi.TransactionContextInt
 		return err
 	}
 	if exists {
-		return fmt.Errorf("the enterprise %s already exists", id)
+		return certifyerr.Errorf(certifyerr.TypeAlreadyExists, "the enterprise %s already exists", id)
 	}
 
 	enterprise := Enterprise{
@@ -65,26 +77,33 @@ func (s *SmartContract) RegisterEnterprise(ctx contractapi.TransactionContextInt
 		UpdatedAt:     time.Now(),
 	}
 
+	if err := appendTransition(ctx, &enterprise, "", "REGISTERED", ""); err != nil {
+		return err
+	}
+
 	enterpriseJSON, err := json.Marshal(enterprise)
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(id, enterpriseJSON)
+	if err := ctx.GetStub().PutState(enterpriseKey(id), enterpriseJSON); err != nil {
+		return err
+	}
+
+	return emitEnterpriseRegistered(ctx, &enterprise)
 }
 
 func (s *SmartContract) EnterpriseExists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
-	enterpriseJSON, err := ctx.GetStub().GetState(id)
+	enterpriseJSON, err := ctx.GetStub().GetState(enterpriseKey(id))
 	if err != nil {
-		return false, fmt.Errorf("failed to read from world state: %v", err)
+		return false, certifyerr.Errorf(certifyerr.TypeInternal, "failed to read from world state: %v", err)
 	}
 
 	return enterpriseJSON != nil, nil
 }
 
-func (s *SmartContract) CertifyEnterprise(ctx contractapi.TransactionContextInterface, id string) error {
-	err := checkRole(ctx, "certifier")
-	if err != nil {
+func (s *SmartContract) CertifyEnterprise(ctx contractapi.TransactionContextInterface, id string, publicKeyPEM string) error {
+	if _, err := requireAdmin(ctx, ScopeCertifier); err != nil {
 		return err
 	}
 
@@ -94,25 +113,36 @@ func (s *SmartContract) CertifyEnterprise(ctx contractapi.TransactionContextInte
 	}
 
 	if enterprise.State != "REGISTERED" {
-		return fmt.Errorf("enterprise %s is not in REGISTERED state", id)
+		return certifyerr.Errorf(certifyerr.TypeInvalidStateTransition, "enterprise %s is not in REGISTERED state", id)
+	}
+
+	now := time.Now().UTC()
+
+	if err := appendTransition(ctx, enterprise, "REGISTERED", "CERTIFIED", ""); err != nil {
+		return err
 	}
 
 	enterprise.State = "CERTIFIED"
-	enterprise.CertificationDate = time.Now()
+	enterprise.CertificationDate = now
 	enterprise.CertificateID = generateCertificateID()
-	enterprise.UpdatedAt = time.Now()
+	enterprise.CertificateExpiry = now.AddDate(0, 0, defaultCertificateValidityDays)
+	enterprise.PublicKey = publicKeyPEM
+	enterprise.UpdatedAt = now
 
 	enterpriseJSON, err := json.Marshal(enterprise)
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(id, enterpriseJSON)
+	if err := ctx.GetStub().PutState(enterpriseKey(id), enterpriseJSON); err != nil {
+		return err
+	}
+
+	return emitEnterpriseCertified(ctx, enterprise)
 }
 
 func (s *SmartContract) RevokeCertification(ctx contractapi.TransactionContextInterface, id string, reason string) error {
-	err := checkRole(ctx, "certifier")
-	if err != nil {
+	if _, err := requireAdmin(ctx, ScopeCertifier); err != nil {
 		return err
 	}
 
@@ -122,7 +152,11 @@ func (s *SmartContract) RevokeCertification(ctx contractapi.TransactionContextIn
 	}
 
 	if enterprise.State != "CERTIFIED" {
-		return fmt.Errorf("enterprise %s is not CERTIFIED", id)
+		return certifyerr.Errorf(certifyerr.TypeInvalidStateTransition, "enterprise %s is not CERTIFIED", id)
+	}
+
+	if err := appendTransition(ctx, enterprise, "CERTIFIED", "REVOKED", reason); err != nil {
+		return err
 	}
 
 	enterprise.State = "REVOKED"
@@ -135,12 +169,15 @@ func (s *SmartContract) RevokeCertification(ctx contractapi.TransactionContextIn
 		return err
 	}
 
-	return ctx.GetStub().PutState(id, enterpriseJSON)
+	if err := ctx.GetStub().PutState(enterpriseKey(id), enterpriseJSON); err != nil {
+		return err
+	}
+
+	return emitCertificationRevoked(ctx, enterprise, enterprise.CertificateID)
 }
 
 func (s *SmartContract) BlacklistEnterprise(ctx contractapi.TransactionContextInterface, id string, reason string) error {
-	err := checkRole(ctx, "admin")
-	if err != nil {
+	if _, err := requireAdmin(ctx, ScopeAdmin); err != nil {
 		return err
 	}
 
@@ -150,29 +187,34 @@ func (s *SmartContract) BlacklistEnterprise(ctx contractapi.TransactionContextIn
 	}
 
 	if enterprise.State == "BLACKLISTED" {
-		return fmt.Errorf("enterprise %s is already blacklisted", id)
+		return certifyerr.Errorf(certifyerr.TypeInvalidStateTransition, "enterprise %s is already blacklisted", id)
 	}
 
 	previousState := enterprise.State
 
+	if err := appendTransition(ctx, enterprise, previousState, "BLACKLISTED", reason); err != nil {
+		return err
+	}
+
 	enterprise.State = "BLACKLISTED"
 	enterprise.BlacklistDate = time.Now().UTC()
 	enterprise.BlacklistReason = reason
 	enterprise.UpdatedAt = time.Now().UTC()
 
-	enterprise.Details = fmt.Sprintf("%s|PREVIOUS_STATE:%s", enterprise.Details, previousState)
-
 	enterpriseJSON, err := json.Marshal(enterprise)
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(id, enterpriseJSON)
+	if err := ctx.GetStub().PutState(enterpriseKey(id), enterpriseJSON); err != nil {
+		return err
+	}
+
+	return emitEnterpriseBlacklisted(ctx, enterprise)
 }
 
 func (s *SmartContract) UnblacklistEnterprise(ctx contractapi.TransactionContextInterface, id string) error {
-	err := checkRole(ctx, "admin")
-	if err != nil {
+	if _, err := requireAdmin(ctx, ScopeAdmin); err != nil {
 		return err
 	}
 
@@ -182,16 +224,19 @@ func (s *SmartContract) UnblacklistEnterprise(ctx contractapi.TransactionContext
 	}
 
 	if enterprise.State != "BLACKLISTED" {
-		return fmt.Errorf("enterprise %s is failing to bee blacklisted", id)
+		return certifyerr.Errorf(certifyerr.TypeInvalidStateTransition, "enterprise %s is failing to bee blacklisted", id)
 	}
 
-	detailsParts := strings.Split(enterprise.Details, "|PREVIOUS_STATE:")
-	if len(detailsParts) != 2 {
-		return fmt.Errorf("unable to determine previous state for enterprise %s", id)
+	previousState, err := lastNonBlacklistedState(enterprise.History)
+	if err != nil {
+		return certifyerr.Errorf(certifyerr.TypeInternal, "unable to determine previous state for enterprise %s: %v", id, err)
 	}
 
-	enterprise.State = detailsParts[1]
-	enterprise.Details = detailsParts[0]
+	if err := appendTransition(ctx, enterprise, "BLACKLISTED", previousState, ""); err != nil {
+		return err
+	}
+
+	enterprise.State = previousState
 	enterprise.BlacklistDate = time.Time{}
 	enterprise.BlacklistReason = ""
 	enterprise.UpdatedAt = time.Now().UTC()
@@ -201,12 +246,15 @@ func (s *SmartContract) UnblacklistEnterprise(ctx contractapi.TransactionContext
 		return err
 	}
 
-	return ctx.GetStub().PutState(id, enterpriseJSON)
+	if err := ctx.GetStub().PutState(enterpriseKey(id), enterpriseJSON); err != nil {
+		return err
+	}
+
+	return emitEnterpriseUnblacklisted(ctx, enterprise)
 }
 
 func (s *SmartContract) AssignOrganizations(ctx contractapi.TransactionContextInterface, id string, organizations []string) error {
-	err := checkRole(ctx, "admin")
-	if err != nil {
+	if _, err := requireAdmin(ctx, ScopeAdmin); err != nil {
 		return err
 	}
 
@@ -223,12 +271,15 @@ func (s *SmartContract) AssignOrganizations(ctx contractapi.TransactionContextIn
 		return err
 	}
 
-	return ctx.GetStub().PutState(id, enterpriseJSON)
+	if err := ctx.GetStub().PutState(enterpriseKey(id), enterpriseJSON); err != nil {
+		return err
+	}
+
+	return emitOrganizationsAssigned(ctx, enterprise)
 }
 
 func (s *SmartContract) AssignChannels(ctx contractapi.TransactionContextInterface, id string, channels []string) error {
-	err := checkRole(ctx, "admin")
-	if err != nil {
+	if _, err := requireAdmin(ctx, ScopeAdmin); err != nil {
 		return err
 	}
 
@@ -245,16 +296,20 @@ func (s *SmartContract) AssignChannels(ctx contractapi.TransactionContextInterfa
 		return err
 	}
 
-	return ctx.GetStub().PutState(id, enterpriseJSON)
+	if err := ctx.GetStub().PutState(enterpriseKey(id), enterpriseJSON); err != nil {
+		return err
+	}
+
+	return emitChannelsAssigned(ctx, enterprise)
 }
 
 func (s *SmartContract) QueryEnterprise(ctx contractapi.TransactionContextInterface, id string) (*Enterprise, error) {
-	enterpriseJSON, err := ctx.GetStub().GetState(id)
+	enterpriseJSON, err := ctx.GetStub().GetState(enterpriseKey(id))
 	if err != nil {
-		return nil, fmt.Errorf("failed to read from world state: %v", err)
+		return nil, certifyerr.Errorf(certifyerr.TypeInternal, "failed to read from world state: %v", err)
 	}
 	if enterpriseJSON == nil {
-		return nil, fmt.Errorf("the enterprise %s does not exist", id)
+		return nil, certifyerr.Errorf(certifyerr.TypeEnterpriseNotFound, "the enterprise %s does not exist", id)
 	}
 
 	var enterprise Enterprise
@@ -266,50 +321,28 @@ func (s *SmartContract) QueryEnterprise(ctx contractapi.TransactionContextInterf
 	return &enterprise, nil
 }
 
-func (s *SmartContract) QueryBlacklistedEnterprises(ctx contractapi.TransactionContextInterface) ([]*Enterprise, error) {
-	queryString := fmt.Sprintf(`{"selector":{"docType":"enterprise", "state":"BLACKLISTED"}}`)
-	return getQueryResultForQueryString(ctx, queryString)
+// QueryBlacklistedEnterprises returns a paginated page of blacklisted
+// enterprises. It delegates to QueryByState so a single unpaginated
+// GetQueryResult iterator can no longer OOM the peer on realistic ledgers.
+func (s *SmartContract) QueryBlacklistedEnterprises(ctx contractapi.TransactionContextInterface, cursor string, limit int32) (*EnterprisePage, error) {
+	return s.QueryByState(ctx, "BLACKLISTED", cursor, limit)
 }
 
-func getQueryResultForQueryString(ctx contractapi.TransactionContextInterface, queryString string) ([]*Enterprise, error) {
-	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
-	if err != nil {
-		return nil, err
-	}
-	defer resultsIterator.Close()
-
-	var enterprises []*Enterprise
-	for resultsIterator.HasNext() {
-		queryResult, err := resultsIterator.Next()
-		if err != nil {
-			return nil, err
-		}
-
-		var enterprise Enterprise
-		err = json.Unmarshal(queryResult.Value, &enterprise)
-		if err != nil {
-			return nil, err
-		}
-
-		enterprises = append(enterprises, &enterprise)
-	}
-	return enterprises, nil
-}
 func checkRole(ctx contractapi.TransactionContextInterface, requiredRole string) error {
 	clientID, err := cid.GetID(ctx.GetStub())
 	if err != nil {
-		return fmt.Errorf("failed to get client identity: %v", err)
+		return certifyerr.Errorf(certifyerr.TypeInternal, "failed to get client identity: %v", err)
 	}
 
 	role, ok, err := cid.GetAttributeValue(ctx.GetStub(), "role")
 	if err != nil {
-		return fmt.Errorf("failed to get role attribute: %v", err)
+		return certifyerr.Errorf(certifyerr.TypeInternal, "failed to get role attribute: %v", err)
 	}
 	if !ok {
-		return fmt.Errorf("client %s does not have role attribute", clientID)
+		return certifyerr.Errorf(certifyerr.TypeUnauthorizedRole, "client %s does not have role attribute", clientID)
 	}
 	if role != requiredRole {
-		return fmt.Errorf("client %s does not have required role: %s", clientID, requiredRole)
+		return certifyerr.Errorf(certifyerr.TypeUnauthorizedRole, "client %s does not have required role: %s", clientID, requiredRole)
 	}
 
 	return nil
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/tox-in/Certify/certifyerr"
+)
+
+// defaultQueryLimit and maxQueryLimit bound how many results a single page
+// can return, so a caller can't force the peer to materialize an entire
+// ledger's worth of enterprises in one call.
+const (
+	defaultQueryLimit int32 = 20
+	maxQueryLimit     int32 = 200
+)
+
+// EnterprisePage is a single page of enterprises, plus the opaque cursor to
+// pass back in to fetch the next page.
+type EnterprisePage struct {
+	Enterprises []*Enterprise `json:"enterprises"`
+	NextCursor  string        `json:"nextCursor"`
+}
+
+// ParseCursor validates a (cursor, limit) pair coming in from a caller.
+// cursor is an opaque bookmark produced by a previous page and is passed
+// through unchanged; limit is clamped to defaultQueryLimit when unset and
+// rejected outright when it exceeds maxQueryLimit.
+func ParseCursor(cursor string, limit int32) (string, int32, error) {
+	if limit == 0 {
+		limit = defaultQueryLimit
+	}
+	if limit < 0 {
+		return "", 0, certifyerr.Errorf(certifyerr.TypeInvalidArgument, "limit %d must not be negative", limit)
+	}
+	if limit > maxQueryLimit {
+		return "", 0, certifyerr.Errorf(certifyerr.TypeInvalidArgument, "limit %d exceeds maximum of %d", limit, maxQueryLimit)
+	}
+	return cursor, limit, nil
+}
+
+// QueryEnterprises runs an arbitrary CouchDB selector against the
+// enterprise docType and returns a paginated result. selector is merged
+// with docType:"enterprise" so callers cannot accidentally page over other
+// document types stored in the same ledger.
+func (s *SmartContract) QueryEnterprises(ctx contractapi.TransactionContextInterface, selector string, cursor string, limit int32) (*EnterprisePage, error) {
+	var selectorFields map[string]interface{}
+	if selector == "" {
+		selectorFields = map[string]interface{}{}
+	} else if err := json.Unmarshal([]byte(selector), &selectorFields); err != nil {
+		return nil, certifyerr.Errorf(certifyerr.TypeInvalidArgument, "invalid selector: %v", err)
+	}
+	selectorFields["docType"] = "enterprise"
+
+	queryString, err := json.Marshal(map[string]interface{}{"selector": selectorFields})
+	if err != nil {
+		return nil, err
+	}
+
+	return queryEnterprisesPaginated(ctx, string(queryString), cursor, limit)
+}
+
+// QueryByState returns enterprises currently in the given state (e.g.
+// REGISTERED, CERTIFIED, REVOKED, BLACKLISTED).
+func (s *SmartContract) QueryByState(ctx contractapi.TransactionContextInterface, state string, cursor string, limit int32) (*EnterprisePage, error) {
+	queryString := fmt.Sprintf(`{"selector":{"docType":"enterprise","state":%s}}`, jsonString(state))
+	return queryEnterprisesPaginated(ctx, queryString, cursor, limit)
+}
+
+// QueryByOrganization returns enterprises assigned to the given organization.
+func (s *SmartContract) QueryByOrganization(ctx contractapi.TransactionContextInterface, organization string, cursor string, limit int32) (*EnterprisePage, error) {
+	queryString := fmt.Sprintf(`{"selector":{"docType":"enterprise","organizations":{"$elemMatch":{"$eq":%s}}}}`, jsonString(organization))
+	return queryEnterprisesPaginated(ctx, queryString, cursor, limit)
+}
+
+// QueryByChannel returns enterprises assigned to the given channel.
+func (s *SmartContract) QueryByChannel(ctx contractapi.TransactionContextInterface, channel string, cursor string, limit int32) (*EnterprisePage, error) {
+	queryString := fmt.Sprintf(`{"selector":{"docType":"enterprise","channels":{"$elemMatch":{"$eq":%s}}}}`, jsonString(channel))
+	return queryEnterprisesPaginated(ctx, queryString, cursor, limit)
+}
+
+// QueryCertifiedBetween returns enterprises certified within [from, to].
+// The bounds are formatted with RFC3339Nano, matching the precision
+// encoding/json uses to marshal CertificationDate, so the CouchDB string
+// comparison stays monotonic with real time instead of truncating
+// fractional seconds off of from/to.
+func (s *SmartContract) QueryCertifiedBetween(ctx contractapi.TransactionContextInterface, from time.Time, to time.Time, cursor string, limit int32) (*EnterprisePage, error) {
+	queryString := fmt.Sprintf(
+		`{"selector":{"docType":"enterprise","certificationDate":{"$gte":%s,"$lte":%s}}}`,
+		jsonString(from.UTC().Format(time.RFC3339Nano)),
+		jsonString(to.UTC().Format(time.RFC3339Nano)),
+	)
+	return queryEnterprisesPaginated(ctx, queryString, cursor, limit)
+}
+
+// QueryRevokedByReason returns revoked enterprises matching the given
+// revocation reason.
+func (s *SmartContract) QueryRevokedByReason(ctx contractapi.TransactionContextInterface, reason string, cursor string, limit int32) (*EnterprisePage, error) {
+	queryString := fmt.Sprintf(
+		`{"selector":{"docType":"enterprise","state":"REVOKED","revocationReason":%s}}`,
+		jsonString(reason),
+	)
+	return queryEnterprisesPaginated(ctx, queryString, cursor, limit)
+}
+
+func queryEnterprisesPaginated(ctx contractapi.TransactionContextInterface, queryString string, cursor string, limit int32) (*EnterprisePage, error) {
+	cursor, limit, err := ParseCursor(cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetQueryResultWithPagination(queryString, limit, cursor)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var enterprises []*Enterprise
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var enterprise Enterprise
+		if err := json.Unmarshal(queryResult.Value, &enterprise); err != nil {
+			return nil, err
+		}
+		enterprises = append(enterprises, &enterprise)
+	}
+
+	return &EnterprisePage{Enterprises: enterprises, NextCursor: responseMetadata.Bookmark}, nil
+}
+
+// jsonString renders s as a JSON string literal so it can be interpolated
+// into a hand-built selector without breaking out of it.
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}